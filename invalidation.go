@@ -0,0 +1,142 @@
+package cache
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// InvalidationBus broadcasts invalidated keys between cache instances.
+//
+// Implementations must not deliver an instance's own messages back to it.
+// If they resubscribe after losing their connection, they must call onClear,
+// since anything published in the meantime was missed.
+type InvalidationBus interface {
+	// Publish announces that key changed on this instance.
+	Publish(ctx context.Context, key string) error
+	// PublishClear announces that this instance cleared its cache.
+	PublishClear(ctx context.Context) error
+	// Subscribe calls onKey for every key and onClear for every clear
+	// published by other instances until ctx is done. It returns once the
+	// subscription is active, and calls onClear again on every resubscribe.
+	Subscribe(ctx context.Context, onKey func(key string), onClear func()) error
+}
+
+const (
+	// syncQueueSize bounds the changes waiting to be published by SyncCache.
+	syncQueueSize = 1024
+	// syncPublishTimeout bounds each publish made by SyncCache.
+	syncPublishTimeout = 5 * time.Second
+)
+
+// SyncCache keeps c consistent with other instances sharing bus. Local sets,
+// updates, deletes and clears are published, and keys published by other
+// instances are removed from c so the next read goes back to the source of
+// truth. Fill and GetOrSet loads are not published, since they store values
+// that have not changed. Syncing stops when ctx is done.
+//
+// Changes are queued and published in order by a background goroutine, so
+// a slow bus never blocks writers. If the queue fills up, the pending keys
+// are replaced by a single clear, which invalidates them on every other
+// instance. Each publish is given syncPublishTimeout to complete.
+//
+// Publish failures are passed to onError, which may be nil; the key is empty
+// for a failed clear. A failed publish leaves other instances stale until
+// their copy expires.
+func SyncCache(ctx context.Context, c *Cache, bus InvalidationBus, onError func(key string, err error)) error {
+	if err := bus.Subscribe(ctx, c.invalidate, c.invalidateAll); err != nil {
+		return err
+	}
+
+	p := &publisher{
+		bus:     bus,
+		queue:   make(chan syncEvent, syncQueueSize),
+		onError: onError,
+	}
+	go p.run(ctx)
+
+	c.SetChangeCallback(func(key string) {
+		if ctx.Err() == nil {
+			p.enqueue(syncEvent{key: key})
+		}
+	})
+	c.SetClearCallback(func() {
+		if ctx.Err() == nil {
+			p.enqueue(syncEvent{clear: true})
+		}
+	})
+	return nil
+}
+
+// syncEvent is a local change waiting to be published.
+type syncEvent struct {
+	key   string
+	clear bool // The whole cache was cleared; key is unused
+}
+
+// publisher forwards local changes to an InvalidationBus for SyncCache.
+type publisher struct {
+	bus        InvalidationBus
+	queue      chan syncEvent
+	overflowed atomic.Bool // Events were dropped; publish a clear instead
+	onError    func(key string, err error)
+}
+
+// enqueue queues an event without blocking. If the queue is full, the event
+// is dropped and a clear is published in its place.
+func (p *publisher) enqueue(e syncEvent) {
+	select {
+	case p.queue <- e:
+	default:
+		p.overflowed.Store(true)
+	}
+}
+
+// run publishes queued events until ctx is done.
+func (p *publisher) run(ctx context.Context) {
+	for {
+		select {
+		case e := <-p.queue:
+			// The queue was full when the flag was set, so an event always
+			// follows an overflow and the clear is published promptly
+			if p.overflowed.Swap(false) {
+				p.publish(ctx, syncEvent{clear: true})
+			}
+			p.publish(ctx, e)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// publish sends a single event, reporting failures to onError.
+func (p *publisher) publish(ctx context.Context, e syncEvent) {
+	ctx, cancel := context.WithTimeout(ctx, syncPublishTimeout)
+	defer cancel()
+
+	var err error
+	if e.clear {
+		err = p.bus.PublishClear(ctx)
+	} else {
+		err = p.bus.Publish(ctx, e.key)
+	}
+	if err != nil && p.onError != nil {
+		p.onError(e.key, err)
+	}
+}
+
+// invalidate removes an item on behalf of another instance.
+// Unlike Delete, it does not call the change callback.
+func (c *cache) invalidate(key string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.deleteItem(key)
+}
+
+// invalidateAll clears the cache on behalf of another instance.
+// Unlike Clear, it does not call the clear callback.
+func (c *cache) invalidateAll() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.clear()
+}
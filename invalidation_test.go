@@ -0,0 +1,274 @@
+package cache
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryHub connects memoryBus instances within a single process.
+type memoryHub struct {
+	mutex sync.Mutex
+	buses []*memoryBus
+}
+
+// memoryBus is an InvalidationBus for tests that delivers messages synchronously.
+type memoryBus struct {
+	hub       *memoryHub
+	onKey     func(key string)
+	onClear   func()
+	published int
+}
+
+func (h *memoryHub) newBus() *memoryBus {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	b := &memoryBus{hub: h}
+	h.buses = append(h.buses, b)
+	return b
+}
+
+func (b *memoryBus) Publish(ctx context.Context, key string) error {
+	b.hub.mutex.Lock()
+	defer b.hub.mutex.Unlock()
+	b.published++
+	for _, other := range b.hub.buses {
+		if other != b && other.onKey != nil {
+			other.onKey(key)
+		}
+	}
+	return nil
+}
+
+func (b *memoryBus) PublishClear(ctx context.Context) error {
+	b.hub.mutex.Lock()
+	defer b.hub.mutex.Unlock()
+	b.published++
+	for _, other := range b.hub.buses {
+		if other != b && other.onClear != nil {
+			other.onClear()
+		}
+	}
+	return nil
+}
+
+// publishedCount returns the number of messages b has published.
+func (b *memoryBus) publishedCount() int {
+	b.hub.mutex.Lock()
+	defer b.hub.mutex.Unlock()
+	return b.published
+}
+
+func (b *memoryBus) Subscribe(ctx context.Context, onKey func(key string), onClear func()) error {
+	b.hub.mutex.Lock()
+	defer b.hub.mutex.Unlock()
+	b.onKey = onKey
+	b.onClear = onClear
+	return nil
+}
+
+// syncedCaches returns two caches kept in sync through a memoryHub.
+func syncedCaches(t *testing.T) (*Cache, *memoryBus, *Cache, *memoryBus) {
+	hub := &memoryHub{}
+	cache1, bus1 := setupCache(0, 1*time.Minute, 10), hub.newBus()
+	cache2, bus2 := setupCache(0, 1*time.Minute, 10), hub.newBus()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	if err := SyncCache(ctx, cache1, bus1, nil); err != nil {
+		t.Fatalf("SyncCache failed. Err: %v", err)
+	}
+	if err := SyncCache(ctx, cache2, bus2, nil); err != nil {
+		t.Fatalf("SyncCache failed. Err: %v", err)
+	}
+	return cache1, bus1, cache2, bus2
+}
+
+// waitPublished waits until bus has published n messages. SyncCache
+// publishes in the background, so changes reach other instances shortly
+// after the call that made them.
+func waitPublished(t *testing.T, bus *memoryBus, n int) {
+	deadline := time.Now().Add(time.Second)
+	for bus.publishedCount() < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d messages to be published, got %d", n, bus.publishedCount())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSyncCache(t *testing.T) {
+	cache1, bus1, cache2, bus2 := syncedCaches(t)
+
+	cache1.Set("key1", "value1", 0)
+	waitPublished(t, bus1, 1)
+	cache2.Set("key1", "value1", 0)
+	waitPublished(t, bus2, 1)
+	if cache1.Exists("key1") {
+		t.Errorf("Set on one instance did not invalidate the other")
+	}
+	if !cache2.Exists("key1") {
+		t.Errorf("Set removed the key on the instance that set it")
+	}
+
+	cache1.Set("key2", "value2", 0)
+	waitPublished(t, bus1, 2)
+	cache2.Delete("key2")
+	waitPublished(t, bus2, 2)
+	if cache1.Exists("key2") {
+		t.Errorf("Delete on one instance did not invalidate the other")
+	}
+}
+
+func TestSyncCache_FillIsNotBroadcast(t *testing.T) {
+	cache1, bus1, cache2, bus2 := syncedCaches(t)
+
+	loads := 0
+	loader := func() (interface{}, error) {
+		loads++
+		return "loaded", nil
+	}
+	for i := 0; i < 20; i++ {
+		cache := cache1
+		if i%2 == 1 {
+			cache = cache2
+		}
+		if val, err := cache.GetOrSet("key1", 0, loader); err != nil || val != "loaded" {
+			t.Fatalf("GetOrSet failed. Err: %v, Val: %v", err, val)
+		}
+	}
+
+	// Each instance loads once; neither fill invalidates the other's copy
+	if loads != 2 {
+		t.Errorf("Expected the loader to run once per instance, ran %d times", loads)
+	}
+	if n1, n2 := bus1.publishedCount(), bus2.publishedCount(); n1 != 0 || n2 != 0 {
+		t.Errorf("Fills were broadcast: %d and %d messages", n1, n2)
+	}
+}
+
+func TestSyncCache_Clear(t *testing.T) {
+	cache1, bus1, cache2, _ := syncedCaches(t)
+	cache1.Set("key1", "value1", 0)
+	cache1.Set("key2", "value2", 0)
+	cache2.Fill("key3", "value3", 0) // Only present on the other instance
+	waitPublished(t, bus1, 2)
+
+	cache1.Clear()
+
+	waitPublished(t, bus1, 3)
+	time.Sleep(10 * time.Millisecond)
+	if n := bus1.publishedCount(); n != 3 {
+		t.Errorf("Expected Clear to publish one message, published %d", n-2)
+	}
+	if len(cache2.Keys()) != 0 {
+		t.Errorf("Clear did not clear the other instance. Keys left: %v", cache2.Keys())
+	}
+}
+
+func TestSyncCache_InvalidationCancelsLoad(t *testing.T) {
+	cache1, _, _, bus2 := syncedCaches(t)
+
+	// Another instance changes the key while cache1 is still loading it
+	val, err := cache1.GetOrSet("key1", 0, func() (interface{}, error) {
+		if err := bus2.Publish(context.Background(), "key1"); err != nil {
+			t.Errorf("Publish failed. Err: %v", err)
+		}
+		return "stale", nil
+	})
+	if err != nil || val != "stale" {
+		t.Errorf("GetOrSet failed. Err: %v, Val: %v", err, val)
+	}
+	if cache1.Exists("key1") {
+		t.Errorf("A load raced by a remote invalidation was stored")
+	}
+
+	// A remote clear cancels every pending load the same way
+	cache1.GetOrSet("key2", 0, func() (interface{}, error) {
+		if err := bus2.PublishClear(context.Background()); err != nil {
+			t.Errorf("PublishClear failed. Err: %v", err)
+		}
+		return "stale", nil
+	})
+	if cache1.Exists("key2") {
+		t.Errorf("A load raced by a remote clear was stored")
+	}
+
+	// Without an invalidation, the load is stored as usual
+	cache1.GetOrSet("key3", 0, func() (interface{}, error) { return "loaded", nil })
+	if !cache1.Exists("key3") {
+		t.Errorf("GetOrSet did not store an uncontested load")
+	}
+}
+
+// slowBus is an InvalidationBus whose publishes wait until release is closed.
+type slowBus struct {
+	release chan struct{}
+	mutex   sync.Mutex
+	keys    []string
+	clears  int
+}
+
+func (b *slowBus) Publish(ctx context.Context, key string) error {
+	select {
+	case <-b.release:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.keys = append(b.keys, key)
+	return nil
+}
+
+func (b *slowBus) PublishClear(ctx context.Context) error {
+	select {
+	case <-b.release:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.clears++
+	return nil
+}
+
+func (b *slowBus) Subscribe(ctx context.Context, onKey func(key string), onClear func()) error {
+	return nil
+}
+
+func TestSyncCache_SlowBusOverflow(t *testing.T) {
+	cache := setupCache(0, 1*time.Minute, 10)
+	bus := &slowBus{release: make(chan struct{})}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := SyncCache(ctx, cache, bus, nil); err != nil {
+		t.Fatalf("SyncCache failed. Err: %v", err)
+	}
+
+	// Writers are not held up while the bus is stuck, even past the queue size
+	total := syncQueueSize + 10
+	for i := 0; i < total; i++ {
+		cache.Set("key"+strconv.Itoa(i), i, 0)
+	}
+	close(bus.release)
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		bus.mutex.Lock()
+		keys, clears := len(bus.keys), bus.clears
+		bus.mutex.Unlock()
+		if clears > 0 && keys >= syncQueueSize {
+			// The dropped keys are covered by a single clear
+			if clears != 1 || keys >= total {
+				t.Errorf("Expected one clear in place of the dropped keys, got %d clears and %d keys", clears, keys)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Queued changes were not published. Clears: %d, Keys: %d", clears, keys)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
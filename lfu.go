@@ -0,0 +1,135 @@
+package cache
+
+import (
+	"container/list"
+	"sort"
+)
+
+// lfuIndex orders keys by access count for EvictLFU in O(1) per operation.
+// It keeps a list of frequency nodes sorted by count; each node lists its
+// keys with the most recently used at the front.
+type lfuIndex struct {
+	nodes   *list.List           // *lfuNode values, lowest count first
+	entries map[string]*lfuEntry // Position of each key
+}
+
+// lfuNode holds the keys that share an access count.
+type lfuNode struct {
+	count int
+	keys  *list.List // Key strings, most recently used first
+}
+
+// lfuEntry locates a key within the index.
+type lfuEntry struct {
+	node *list.Element // Element of nodes holding the key's lfuNode
+	key  *list.Element // Element of that node's keys
+}
+
+func newLFUIndex() *lfuIndex {
+	return &lfuIndex{
+		nodes:   list.New(),
+		entries: make(map[string]*lfuEntry),
+	}
+}
+
+// buildLFUIndex indexes the keys of an LRU list, preserving recency order
+// between keys with the same access count.
+func buildLFUIndex(lru *list.List, items map[string]Item) *lfuIndex {
+	keys := make([]string, 0, lru.Len())
+	for e := lru.Back(); e != nil; e = e.Prev() {
+		keys = append(keys, e.Value.(string))
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		return items[keys[i]].accesses < items[keys[j]].accesses
+	})
+
+	idx := newLFUIndex()
+	for _, k := range keys {
+		idx.add(k, items[k].accesses)
+	}
+	return idx
+}
+
+// add inserts a key with the given access count as the most recently used
+// key of that count. It is O(1) for a count of 0 or when keys are added in
+// ascending count order.
+func (idx *lfuIndex) add(key string, count int) {
+	var node *list.Element
+	if count == 0 {
+		node = idx.nodes.Front()
+		if node == nil || node.Value.(*lfuNode).count != 0 {
+			node = idx.nodes.PushFront(&lfuNode{count: 0, keys: list.New()})
+		}
+	} else {
+		at := idx.nodes.Back()
+		for at != nil && at.Value.(*lfuNode).count > count {
+			at = at.Prev()
+		}
+		switch {
+		case at != nil && at.Value.(*lfuNode).count == count:
+			node = at
+		case at != nil:
+			node = idx.nodes.InsertAfter(&lfuNode{count: count, keys: list.New()}, at)
+		default:
+			node = idx.nodes.PushFront(&lfuNode{count: count, keys: list.New()})
+		}
+	}
+	idx.entries[key] = &lfuEntry{node: node, key: node.Value.(*lfuNode).keys.PushFront(key)}
+}
+
+// touch marks a key as the most recently used of its count.
+func (idx *lfuIndex) touch(key string) {
+	if e, exists := idx.entries[key]; exists {
+		e.node.Value.(*lfuNode).keys.MoveToFront(e.key)
+	}
+}
+
+// increment moves a key to the node for its next access count.
+func (idx *lfuIndex) increment(key string) {
+	e, exists := idx.entries[key]
+	if !exists {
+		return
+	}
+
+	current := e.node.Value.(*lfuNode)
+	next := e.node.Next()
+	if next == nil || next.Value.(*lfuNode).count != current.count+1 {
+		next = idx.nodes.InsertAfter(&lfuNode{count: current.count + 1, keys: list.New()}, e.node)
+	}
+
+	current.keys.Remove(e.key)
+	if current.keys.Len() == 0 {
+		idx.nodes.Remove(e.node)
+	}
+	e.node = next
+	e.key = next.Value.(*lfuNode).keys.PushFront(key)
+}
+
+// remove drops a key from the index.
+func (idx *lfuIndex) remove(key string) {
+	e, exists := idx.entries[key]
+	if !exists {
+		return
+	}
+
+	node := e.node.Value.(*lfuNode)
+	node.keys.Remove(e.key)
+	if node.keys.Len() == 0 {
+		idx.nodes.Remove(e.node)
+	}
+	delete(idx.entries, key)
+}
+
+// victim returns the least recently used key among those with the lowest
+// access count, skipping keep if it is not nil.
+func (idx *lfuIndex) victim(keep *string) (string, bool) {
+	for n := idx.nodes.Front(); n != nil; n = n.Next() {
+		for k := n.Value.(*lfuNode).keys.Back(); k != nil; k = k.Prev() {
+			key := k.Value.(string)
+			if keep == nil || key != *keep {
+				return key, true
+			}
+		}
+	}
+	return "", false
+}
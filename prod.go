@@ -2,7 +2,10 @@ package cache
 
 import (
 	"container/list"
+	"context"
 	"errors"
+	"math"
+	"runtime"
 	"sync"
 	"time"
 )
@@ -11,27 +14,67 @@ import (
 var (
 	ErrItemNotFound = errors.New("item not found")
 	ErrItemExpired  = errors.New("item expired")
+	ErrItemExists   = errors.New("item already exists")
+	ErrNotInteger   = errors.New("item value is not an integer")
+	ErrOverflow     = errors.New("increment overflows the item's integer type")
+	ErrLoaderPanic  = errors.New("loader panicked")
 )
 
 // Item represents a single cache item.
 type Item struct {
 	Value      interface{}
 	Expiration int64
+
+	ttl      time.Duration // Lifetime the item was stored with, used for sliding expiration
+	size     int64         // Size reported by the cache's size function
+	accesses int           // Number of successful Gets, used by LFU eviction
 }
 
+// EvictionPolicy selects which item is removed when the cache is full.
+type EvictionPolicy int
+
+const (
+	// EvictLRU evicts the least recently used item. This is the default.
+	EvictLRU EvictionPolicy = iota
+	// EvictLFU evicts the least frequently used item. Ties are broken by
+	// evicting the least recently used of the candidates.
+	EvictLFU
+)
+
 // Cache represents the in-memory cache.
+//
+// The janitor goroutine only references the embedded cache, so an unused
+// Cache can still be garbage collected; a finalizer then stops the janitor.
 type Cache struct {
+	*cache
+}
+
+type cache struct {
+	ctx              context.Context
 	items            map[string]Item
 	mutex            sync.RWMutex
 	janitor          *janitor
 	defaultDuration  time.Duration
 	stats            CacheStats
 	evictionCallback func(key string, value interface{})
+	expiredCallback  func(key string, value interface{})
+	changeCallback   func(key string)
+	clearCallback    func()
+	expired          []expiredItem // Awaiting the expired callback
+	sliding          bool
 
 	// LRU-related fields
 	maxEntries int
-	lruList    *list.List                   // List to maintain LRU order
-	lruMap     map[string]*list.Element     // Map to quickly access list elements
+	lruList    *list.List               // List to maintain LRU order
+	lruMap     map[string]*list.Element // Map to quickly access list elements
+
+	// Size-bound fields
+	policy   EvictionPolicy
+	lfu      *lfuIndex // Access-count order, only kept while policy is EvictLFU
+	maxBytes int64
+	sizeFunc func(key string, value interface{}) int64
+
+	loads map[string]*loadCall // In-flight GetOrSet loaders by key
 }
 
 // CacheStats holds statistics about cache usage.
@@ -40,142 +83,447 @@ type CacheStats struct {
 	Misses    int
 	Items     int
 	Evictions int
+	Bytes     int64
 }
 
 // NewCache creates a new Cache instance and starts the janitor.
 // If defaultDuration is 0, items will not expire unless a specific duration is set.
 // If maxEntries is greater than 0, the cache will enforce a maximum number of items using LRU eviction.
+// If cleanupInterval is 0, no janitor is started and expired items are only removed on access.
 func NewCache(cleanupInterval time.Duration, defaultDuration time.Duration, maxEntries int) *Cache {
-	c := &Cache{
+	return NewCacheWithContext(context.Background(), cleanupInterval, defaultDuration, maxEntries)
+}
+
+// NewCacheWithContext is like NewCache, but the janitor also stops when ctx is done.
+func NewCacheWithContext(ctx context.Context, cleanupInterval time.Duration, defaultDuration time.Duration, maxEntries int) *Cache {
+	c := &cache{
+		ctx:             ctx,
 		items:           make(map[string]Item),
 		defaultDuration: defaultDuration,
 		maxEntries:      maxEntries,
 		lruList:         list.New(),
 		lruMap:          make(map[string]*list.Element),
+		loads:           make(map[string]*loadCall),
 	}
 	runJanitor(c, cleanupInterval)
-	return c
+
+	C := &Cache{c}
+	runtime.SetFinalizer(C, stopJanitor)
+	return C
 }
 
 // Set adds an item to the cache with a specified duration.
 // If duration is 0, the default duration is used.
 // If both are 0, the item does not expire.
-func (c *Cache) Set(key string, value interface{}, duration time.Duration) {
-	var expiration int64
-	if duration > 0 {
-		expiration = time.Now().Add(duration).UnixNano()
-	} else if c.defaultDuration > 0 {
-		expiration = time.Now().Add(c.defaultDuration).UnixNano()
-	} else {
-		expiration = 0
+func (c *cache) Set(key string, value interface{}, duration time.Duration) {
+	ttl := c.ttlFor(duration)
+
+	c.mutex.Lock()
+	c.set(key, value, ttl)
+	c.mutex.Unlock()
+	c.notifyChanged(key)
+}
+
+// SetMany adds several items to the cache with the same duration.
+func (c *cache) SetMany(items map[string]interface{}, duration time.Duration) {
+	ttl := c.ttlFor(duration)
+
+	keys := make([]string, 0, len(items))
+	c.mutex.Lock()
+	for k, v := range items {
+		c.set(k, v, ttl)
+		keys = append(keys, k)
 	}
+	c.mutex.Unlock()
+	c.notifyChanged(keys...)
+}
+
+// Fill stores a value loaded from the source of truth. It behaves like Set
+// but does not call the change callback, so a read-through fill is not
+// broadcast to other instances as a change.
+func (c *cache) Fill(key string, value interface{}, duration time.Duration) {
+	ttl := c.ttlFor(duration)
 
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
+	c.set(key, value, ttl)
+}
+
+// Add stores an item only if the key is not already present.
+// Returns ErrItemExists if an unexpired item exists for the key.
+func (c *cache) Add(key string, value interface{}, duration time.Duration) error {
+	ttl := c.ttlFor(duration)
+
+	c.mutex.Lock()
+	if _, err := c.lookup(key); err == nil {
+		c.unlock()
+		return ErrItemExists
+	}
+	c.set(key, value, ttl)
+	c.unlock()
+	c.notifyChanged(key)
+	return nil
+}
+
+// set adds or replaces an item without locking.
+// Assumes the caller holds the lock.
+func (c *cache) set(key string, value interface{}, ttl time.Duration) {
+	c.cancelLoad(key)
+	var accesses int
 
 	// If the item already exists, update it and move it to the front of the LRU list
 	if element, exists := c.lruMap[key]; exists {
 		c.lruList.MoveToFront(element)
 		element.Value = key
+		accesses = c.items[key].accesses
+		if c.lfu != nil {
+			c.lfu.touch(key)
+		}
 	} else {
 		// If adding a new item, check for capacity
 		if c.maxEntries > 0 && c.lruList.Len() >= c.maxEntries {
-			// Evict the least recently used item
-			c.evictOldest()
+			c.evict(nil)
 		}
 		// Add the new item to the front of the LRU list
 		element := c.lruList.PushFront(key)
 		c.lruMap[key] = element
+		if c.lfu != nil {
+			c.lfu.add(key, 0)
+		}
 		c.stats.Items++
 	}
 
 	// Set or update the item
-	c.items[key] = Item{
+	c.storeItem(key, Item{
 		Value:      value,
-		Expiration: expiration,
-	}
+		Expiration: expiresAt(ttl),
+		ttl:        ttl,
+		accesses:   accesses,
+	})
 }
 
 // Get retrieves an item from the cache.
 // Returns an error if the item does not exist or has expired.
-func (c *Cache) Get(key string) (interface{}, error) {
+func (c *cache) Get(key string) (interface{}, error) {
 	c.mutex.Lock()
-	defer c.mutex.Unlock()
+	defer c.unlock()
+	return c.get(key)
+}
+
+// GetMany retrieves several items from the cache.
+// Keys that do not exist or have expired are left out of the result.
+func (c *cache) GetMany(keys []string) map[string]interface{} {
+	c.mutex.Lock()
+	defer c.unlock()
+	values := make(map[string]interface{}, len(keys))
+	for _, k := range keys {
+		if v, err := c.get(k); err == nil {
+			values[k] = v
+		}
+	}
+	return values
+}
+
+// get retrieves an item and records the hit or miss without locking.
+// Assumes the caller holds the lock.
+func (c *cache) get(key string) (interface{}, error) {
+	item, err := c.lookup(key)
+	if err != nil {
+		c.incrementMisses()
+		return nil, err
+	}
+	return c.hit(key, item), nil
+}
+
+// hit records a successful read of an item returned by lookup.
+// Assumes the caller holds the lock.
+func (c *cache) hit(key string, item Item) interface{} {
+	item.accesses++
+	if c.lfu != nil {
+		c.lfu.increment(key)
+	}
+	if c.sliding && item.ttl > 0 {
+		item.Expiration = expiresAt(item.ttl)
+	}
+	c.items[key] = item
+
+	c.incrementHits()
+	return item.Value
+}
 
+// lookup returns an unexpired item and moves it to the front of the LRU list.
+// Expired items are removed. Assumes the caller holds the lock.
+func (c *cache) lookup(key string) (Item, error) {
 	item, found := c.items[key]
 	if !found {
-		c.incrementMisses()
-		return nil, ErrItemNotFound
+		return Item{}, ErrItemNotFound
 	}
 
 	if item.Expiration > 0 && time.Now().UnixNano() > item.Expiration {
 		// Item has expired
-		c.deleteItem(key)
-		c.incrementMisses()
-		return nil, ErrItemExpired
+		c.expireItem(key)
+		return Item{}, ErrItemExpired
 	}
 
 	// Move the accessed item to the front of the LRU list
 	if element, exists := c.lruMap[key]; exists {
 		c.lruList.MoveToFront(element)
 	}
+	if c.lfu != nil {
+		c.lfu.touch(key)
+	}
+	return item, nil
+}
 
-	c.incrementHits()
-	return item.Value, nil
+// GetOrSet returns the value stored under key. On a miss it calls loader and
+// stores the result with the given duration. Concurrent misses for the same
+// key share a single loader call. Loader errors are returned to every waiting
+// caller and nothing is cached. If the loader panics, the panic propagates to
+// the caller that ran it and the waiting callers get ErrLoaderPanic. If the
+// key is written, deleted or invalidated while the loader runs, the loaded
+// value is returned but not stored, since it may be older than the change.
+func (c *cache) GetOrSet(key string, duration time.Duration, loader func() (interface{}, error)) (interface{}, error) {
+	if value, err := c.Get(key); err == nil {
+		return value, nil
+	}
+
+	c.mutex.Lock()
+	// Another caller may have stored the value since the Get above
+	if item, err := c.lookup(key); err == nil {
+		value := c.hit(key, item)
+		c.unlock()
+		return value, nil
+	}
+	if call, loading := c.loads[key]; loading {
+		c.unlock()
+		call.wg.Wait()
+		return call.value, call.err
+	}
+	call := &loadCall{}
+	call.wg.Add(1)
+	c.loads[key] = call
+	c.unlock()
+
+	ttl := c.ttlFor(duration)
+	completed := false
+	defer func() {
+		if !completed {
+			// The loader panicked; the panic keeps propagating to this caller
+			call.value, call.err = nil, ErrLoaderPanic
+		}
+		c.mutex.Lock()
+		delete(c.loads, key)
+		if call.err == nil && !call.stale {
+			c.set(key, call.value, ttl)
+		}
+		c.mutex.Unlock()
+		call.wg.Done()
+	}()
+
+	call.value, call.err = loader()
+	completed = true
+	return call.value, call.err
 }
 
 // Update modifies the value and/or expiration of an existing item.
+// It is the set-if-present counterpart to Add.
 // Returns an error if the item does not exist or has expired.
-func (c *Cache) Update(key string, value interface{}, duration time.Duration) error {
-	c.mutex.Lock()
-	defer c.mutex.Unlock()
+func (c *cache) Update(key string, value interface{}, duration time.Duration) error {
+	ttl := c.ttlFor(duration)
 
-	item, found := c.items[key]
-	if !found {
+	c.mutex.Lock()
+	item, err := c.lookup(key)
+	if err != nil {
 		c.incrementMisses()
-		return ErrItemNotFound
+		c.unlock()
+		return err
 	}
 
-	if item.Expiration > 0 && time.Now().UnixNano() > item.Expiration {
-		// Item has expired
-		c.deleteItem(key)
-		c.incrementMisses()
-		return ErrItemExpired
+	c.storeItem(key, Item{
+		Value:      value,
+		Expiration: expiresAt(ttl),
+		ttl:        ttl,
+		accesses:   item.accesses,
+	})
+	c.unlock()
+	c.notifyChanged(key)
+
+	return nil
+}
+
+// Touch resets the expiration of an existing item without changing its value.
+// If duration is 0, the default duration is used.
+// Returns an error if the item does not exist or has expired.
+func (c *cache) Touch(key string, duration time.Duration) error {
+	ttl := c.ttlFor(duration)
+
+	c.mutex.Lock()
+	defer c.unlock()
+
+	item, err := c.lookup(key)
+	if err != nil {
+		return err
 	}
 
-	// Update value and expiration
-	var expiration int64
-	if duration > 0 {
-		expiration = time.Now().Add(duration).UnixNano()
-	} else if c.defaultDuration > 0 {
-		expiration = time.Now().Add(c.defaultDuration).UnixNano()
-	} else {
-		expiration = 0
+	item.ttl = ttl
+	item.Expiration = expiresAt(ttl)
+	c.items[key] = item
+	return nil
+}
+
+// Increment adds delta to an integer item and returns the new value.
+// The item keeps its type and expiration. Returns an error if the item does
+// not exist, has expired, or does not hold an integer. Returns ErrOverflow,
+// leaving the item unchanged, if the result does not fit the item's type or
+// an int64.
+func (c *cache) Increment(key string, delta int64) (int64, error) {
+	c.mutex.Lock()
+	n, err := c.increment(key, delta, false)
+	c.unlock()
+	if err != nil {
+		return 0, err
 	}
+	c.notifyChanged(key)
+	return n, nil
+}
 
-	c.items[key] = Item{
-		Value:      value,
-		Expiration: expiration,
+// increment adds delta, or subtracts it if negate is set, to an integer item
+// without locking. Assumes the caller holds the lock.
+func (c *cache) increment(key string, delta int64, negate bool) (int64, error) {
+	item, err := c.lookup(key)
+	if err != nil {
+		return 0, err
 	}
 
-	// Move the updated item to the front of the LRU list
-	if element, exists := c.lruMap[key]; exists {
-		c.lruList.MoveToFront(element)
+	steps := []int64{delta}
+	if negate && delta == math.MinInt64 {
+		// -MinInt64 does not fit an int64, so add MaxInt64 + 1 in two steps
+		steps = []int64{math.MaxInt64, 1}
+	} else if negate {
+		steps = []int64{-delta}
 	}
 
-	return nil
+	var n int64
+	for _, step := range steps {
+		if item.Value, n, err = addInteger(item.Value, step); err != nil {
+			return 0, err
+		}
+	}
+
+	c.storeItem(key, item)
+	return n, nil
+}
+
+// addInteger adds delta to an integer value, keeping its type, and also
+// returns the result as an int64.
+func addInteger(value interface{}, delta int64) (interface{}, int64, error) {
+	var n int64
+	var err error
+	switch v := value.(type) {
+	case int:
+		n, err = addSigned(int64(v), delta, math.MinInt, math.MaxInt)
+		value = int(n)
+	case int8:
+		n, err = addSigned(int64(v), delta, math.MinInt8, math.MaxInt8)
+		value = int8(n)
+	case int16:
+		n, err = addSigned(int64(v), delta, math.MinInt16, math.MaxInt16)
+		value = int16(n)
+	case int32:
+		n, err = addSigned(int64(v), delta, math.MinInt32, math.MaxInt32)
+		value = int32(n)
+	case int64:
+		n, err = addSigned(v, delta, math.MinInt64, math.MaxInt64)
+		value = n
+	case uint:
+		n, err = addUnsigned(uint64(v), delta, math.MaxUint)
+		value = uint(n)
+	case uint8:
+		n, err = addUnsigned(uint64(v), delta, math.MaxUint8)
+		value = uint8(n)
+	case uint16:
+		n, err = addUnsigned(uint64(v), delta, math.MaxUint16)
+		value = uint16(n)
+	case uint32:
+		n, err = addUnsigned(uint64(v), delta, math.MaxUint32)
+		value = uint32(n)
+	case uint64:
+		n, err = addUnsigned(v, delta, math.MaxUint64)
+		value = uint64(n)
+	default:
+		return nil, 0, ErrNotInteger
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	return value, n, nil
+}
+
+// addSigned adds delta to v, failing if the result falls outside [min, max].
+func addSigned(v, delta, min, max int64) (int64, error) {
+	if (delta > 0 && v > max-delta) || (delta < 0 && v < min-delta) {
+		return 0, ErrOverflow
+	}
+	return v + delta, nil
+}
+
+// addUnsigned adds delta to v, failing if the result falls outside [0, max]
+// or cannot be returned as an int64.
+func addUnsigned(v uint64, delta int64, max uint64) (int64, error) {
+	var r uint64
+	if delta >= 0 {
+		if uint64(delta) > max-v {
+			return 0, ErrOverflow
+		}
+		r = v + uint64(delta)
+	} else {
+		d := uint64(-(delta + 1)) + 1 // Avoids overflow when delta is math.MinInt64
+		if d > v {
+			return 0, ErrOverflow
+		}
+		r = v - d
+	}
+	if r > math.MaxInt64 {
+		return 0, ErrOverflow
+	}
+	return int64(r), nil
+}
+
+// Decrement subtracts delta from an integer item and returns the new value.
+// See Increment for details.
+func (c *cache) Decrement(key string, delta int64) (int64, error) {
+	c.mutex.Lock()
+	n, err := c.increment(key, delta, true)
+	c.unlock()
+	if err != nil {
+		return 0, err
+	}
+	c.notifyChanged(key)
+	return n, nil
 }
 
 // Delete removes an item from the cache.
-func (c *Cache) Delete(key string) {
+func (c *cache) Delete(key string) {
 	c.mutex.Lock()
-	defer c.mutex.Unlock()
 	c.deleteItem(key)
+	c.mutex.Unlock()
+	c.notifyChanged(key)
+}
+
+// DeleteMany removes several items from the cache.
+func (c *cache) DeleteMany(keys []string) {
+	c.mutex.Lock()
+	for _, k := range keys {
+		c.deleteItem(k)
+	}
+	c.mutex.Unlock()
+	c.notifyChanged(keys...)
 }
 
 // deleteItem is a helper function to remove an item without locking.
 // Assumes the caller holds the lock.
-func (c *Cache) deleteItem(key string) {
+func (c *cache) deleteItem(key string) {
+	c.cancelLoad(key)
 	item, exists := c.items[key]
 	if !exists {
 		return
@@ -186,17 +534,94 @@ func (c *Cache) deleteItem(key string) {
 		c.lruList.Remove(element)
 		delete(c.lruMap, key)
 	}
+	if c.lfu != nil {
+		c.lfu.remove(key)
+	}
 	c.stats.Items--
+	c.stats.Bytes -= item.size
 
 	if exists && c.evictionCallback != nil {
 		c.evictionCallback(key, item.Value)
 	}
 }
 
+// cancelLoad stops an in-flight GetOrSet load for key from storing its
+// result. Assumes the caller holds the lock.
+func (c *cache) cancelLoad(key string) {
+	if call, loading := c.loads[key]; loading {
+		call.stale = true
+	}
+}
+
+// notifyChanged calls the change callback for each key.
+// Must be called without holding the lock.
+func (c *cache) notifyChanged(keys ...string) {
+	c.mutex.RLock()
+	callback := c.changeCallback
+	c.mutex.RUnlock()
+	if callback == nil {
+		return
+	}
+	for _, k := range keys {
+		callback(k)
+	}
+}
+
+// expireItem removes an item that has expired and queues it for the expired
+// callback, which runs once the lock is released by unlock.
+// Assumes the caller holds the lock.
+func (c *cache) expireItem(key string) {
+	item, exists := c.items[key]
+	if !exists {
+		return
+	}
+
+	c.deleteItem(key)
+	if c.expiredCallback != nil {
+		c.expired = append(c.expired, expiredItem{key: key, value: item.Value})
+	}
+}
+
+// unlock releases the lock and then calls the expired callback for items
+// that expired while it was held. Every method that can expire items must
+// release the lock with unlock instead of c.mutex.Unlock.
+func (c *cache) unlock() {
+	expired := c.expired
+	callback := c.expiredCallback
+	c.expired = nil
+	c.mutex.Unlock()
+
+	if callback == nil {
+		return
+	}
+	for _, e := range expired {
+		callback(e.key, e.value)
+	}
+}
+
+// expiredItem is an item removed on expiry, kept until its callback runs.
+type expiredItem struct {
+	key   string
+	value interface{}
+}
+
 // Clear removes all items from the cache.
-func (c *Cache) Clear() {
+func (c *cache) Clear() {
 	c.mutex.Lock()
-	defer c.mutex.Unlock()
+	c.clear()
+	callback := c.clearCallback
+	c.mutex.Unlock()
+	if callback != nil {
+		callback()
+	}
+}
+
+// clear removes all items without locking.
+// Assumes the caller holds the lock.
+func (c *cache) clear() {
+	for k := range c.loads {
+		c.cancelLoad(k)
+	}
 	for k, v := range c.items {
 		if c.evictionCallback != nil {
 			c.evictionCallback(k, v.Value)
@@ -205,36 +630,40 @@ func (c *Cache) Clear() {
 	c.items = make(map[string]Item)
 	c.lruList.Init()
 	c.lruMap = make(map[string]*list.Element)
-	c.stats.Items = 0
+	if c.lfu != nil {
+		c.lfu = newLFUIndex()
+	}
 	c.stats.Evictions += c.stats.Items
+	c.stats.Items = 0
+	c.stats.Bytes = 0
 }
 
 // Exists checks if a key exists in the cache without retrieving its value.
-func (c *Cache) Exists(key string) bool {
+func (c *cache) Exists(key string) bool {
 	c.mutex.Lock()
-	defer c.mutex.Unlock()
+	defer c.unlock()
+	_, err := c.lookup(key)
+	return err == nil
+}
 
-	item, found := c.items[key]
-	if !found {
-		return false
-	}
+// TTL returns the time left before an item expires, or 0 if it never expires.
+// Returns an error if the item does not exist or has expired.
+func (c *cache) TTL(key string) (time.Duration, error) {
+	c.mutex.Lock()
+	defer c.unlock()
 
-	if item.Expiration > 0 && time.Now().UnixNano() > item.Expiration {
-		// Item has expired
-		c.deleteItem(key)
-		return false
+	item, err := c.lookup(key)
+	if err != nil {
+		return 0, err
 	}
-
-	// Move the accessed item to the front of the LRU list
-	if element, exists := c.lruMap[key]; exists {
-		c.lruList.MoveToFront(element)
+	if item.Expiration == 0 {
+		return 0, nil
 	}
-
-	return true
+	return time.Until(time.Unix(0, item.Expiration)), nil
 }
 
 // Keys returns a slice of all keys currently stored in the cache.
-func (c *Cache) Keys() []string {
+func (c *cache) Keys() []string {
 	c.mutex.RLock()
 	defer c.mutex.RUnlock()
 	keys := make([]string, 0, len(c.items))
@@ -248,68 +677,238 @@ func (c *Cache) Keys() []string {
 }
 
 // Stats returns the current cache statistics.
-func (c *Cache) Stats() CacheStats {
+func (c *cache) Stats() CacheStats {
 	c.mutex.RLock()
 	defer c.mutex.RUnlock()
 	return c.stats
 }
 
 // SetEvictionCallback sets a callback function that is called whenever an item is evicted.
-func (c *Cache) SetEvictionCallback(callback func(key string, value interface{})) {
+func (c *cache) SetEvictionCallback(callback func(key string, value interface{})) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 	c.evictionCallback = callback
 }
 
-// StopJanitor stops the janitor goroutine.
-func (c *Cache) StopJanitor() {
+// SetChangeCallback sets a callback function that is called after an item is
+// set, updated or deleted through the Cache methods. It is not called for
+// Fill, GetOrSet loads, Clear, evictions or expirations. The callback runs
+// without the cache lock held.
+func (c *cache) SetChangeCallback(callback func(key string)) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.changeCallback = callback
+}
+
+// SetClearCallback sets a callback function that is called after Clear.
+// The callback runs without the cache lock held.
+func (c *cache) SetClearCallback(callback func()) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.clearCallback = callback
+}
+
+// SetExpiredCallback sets a callback function that is called whenever an item
+// is removed because it expired, either by the janitor or on access. The
+// callback runs without the cache lock held, so it may use the cache.
+func (c *cache) SetExpiredCallback(callback func(key string, value interface{})) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.expiredCallback = callback
+}
+
+// SetSlidingExpiration enables or disables sliding expiration. When enabled,
+// every successful Get renews the item's expiration by the duration it was
+// stored with.
+func (c *cache) SetSlidingExpiration(enabled bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.sliding = enabled
+}
+
+// SetEvictionPolicy selects how items are chosen for eviction once the
+// cache reaches maxEntries or its byte limit. The default is EvictLRU.
+func (c *cache) SetEvictionPolicy(policy EvictionPolicy) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.policy = policy
+
+	// Only EvictLFU needs the access-count index
+	if policy == EvictLFU && c.lfu == nil {
+		c.lfu = buildLFUIndex(c.lruList, c.items)
+	} else if policy != EvictLFU {
+		c.lfu = nil
+	}
+}
+
+// SetMaxBytes bounds the total size of the cached values. sizeFunc reports
+// the size of a single item; it is called once per Set or Update. Items are
+// evicted according to the eviction policy until the total fits within
+// maxBytes. An item larger than maxBytes on its own is evicted as soon as it
+// is stored. A maxBytes of 0 removes the limit.
+func (c *cache) SetMaxBytes(maxBytes int64, sizeFunc func(key string, value interface{}) int64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.maxBytes = maxBytes
+	c.sizeFunc = sizeFunc
+
+	// Re-measure existing items so the running total matches the new size function
+	var oversized []string
+	c.stats.Bytes = 0
+	for k, v := range c.items {
+		v.size = c.sizeOf(k, v.Value)
+		c.items[k] = v
+		c.stats.Bytes += v.size
+		if maxBytes > 0 && v.size > maxBytes {
+			oversized = append(oversized, k)
+		}
+	}
+
+	// Drop items that can never fit before evicting any that can
+	for _, k := range oversized {
+		c.deleteItem(k)
+		c.stats.Evictions++
+	}
+	c.enforceMaxBytes(nil)
+}
+
+// StopJanitor stops the janitor goroutine. It is safe to call more than once.
+func (c *cache) StopJanitor() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
 	if c.janitor != nil {
-		c.janitor.stop <- true
+		c.janitor.Stop()
+		c.janitor = nil
 	}
 }
 
-// DeleteExpired removes all expired items from the cache.
-func (c *Cache) DeleteExpired() {
+// SetCleanupInterval restarts the janitor with a new interval.
+// An interval of 0 stops the janitor.
+func (c *cache) SetCleanupInterval(interval time.Duration) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
+	if c.janitor != nil {
+		c.janitor.Stop()
+	}
+	runJanitor(c, interval)
+}
+
+// DeleteExpired removes all expired items from the cache.
+func (c *cache) DeleteExpired() {
+	c.mutex.Lock()
+	defer c.unlock()
 	now := time.Now().UnixNano()
 	for k, v := range c.items {
 		if v.Expiration > 0 && now > v.Expiration {
-			c.deleteItem(k)
-			c.stats.Items--
+			c.expireItem(k)
 			c.stats.Evictions++
 		}
 	}
 }
 
 // incrementHits safely increments the hit counter.
-func (c *Cache) incrementHits() {
+func (c *cache) incrementHits() {
 	c.stats.Hits++
 }
 
 // incrementMisses safely increments the miss counter.
-func (c *Cache) incrementMisses() {
+func (c *cache) incrementMisses() {
 	c.stats.Misses++
 }
 
-// evictOldest removes the least recently used item from the cache.
-func (c *Cache) evictOldest() {
-	element := c.lruList.Back()
-	if element != nil {
-		key := element.Value.(string)
+// ttlFor returns the lifetime for an item, falling back to the default
+// duration. Zero means the item never expires.
+func (c *cache) ttlFor(duration time.Duration) time.Duration {
+	if duration > 0 {
+		return duration
+	}
+	return c.defaultDuration
+}
+
+// expiresAt converts a lifetime into an absolute expiration time.
+// Zero means the item never expires.
+func expiresAt(ttl time.Duration) int64 {
+	if ttl > 0 {
+		return time.Now().Add(ttl).UnixNano()
+	}
+	return 0
+}
+
+// storeItem saves an item, keeping the byte count and limit up to date.
+// Assumes the caller holds the lock and the key is already in the LRU list.
+func (c *cache) storeItem(key string, item Item) {
+	item.size = c.sizeOf(key, item.Value)
+	c.stats.Bytes += item.size - c.items[key].size
+	c.items[key] = item
+
+	// An item that can never fit is dropped instead of evicting everything else
+	if c.maxBytes > 0 && item.size > c.maxBytes {
 		c.deleteItem(key)
 		c.stats.Evictions++
+		return
+	}
+	c.enforceMaxBytes(&key)
+}
+
+// sizeOf returns the size of a value as reported by the size function.
+func (c *cache) sizeOf(key string, value interface{}) int64 {
+	if c.sizeFunc == nil {
+		return 0
+	}
+	return c.sizeFunc(key, value)
+}
+
+// enforceMaxBytes evicts items until the cache fits within maxBytes.
+// The item stored under keep, if not nil, is never evicted.
+func (c *cache) enforceMaxBytes(keep *string) {
+	for c.maxBytes > 0 && c.stats.Bytes > c.maxBytes {
+		if !c.evict(keep) {
+			return
+		}
 	}
 }
 
+// evict removes one item according to the eviction policy, skipping keep
+// if it is not nil. It reports whether an item was removed.
+func (c *cache) evict(keep *string) bool {
+	var victim string
+	var found bool
+	if c.lfu != nil {
+		victim, found = c.lfu.victim(keep)
+	} else {
+		for e := c.lruList.Back(); e != nil; e = e.Prev() {
+			if key := e.Value.(string); keep == nil || key != *keep {
+				victim, found = key, true
+				break
+			}
+		}
+	}
+	if !found {
+		return false
+	}
+	c.deleteItem(victim)
+	c.stats.Evictions++
+	return true
+}
+
+// loadCall tracks a GetOrSet loader that is in progress.
+type loadCall struct {
+	wg    sync.WaitGroup
+	stale bool // The key changed during the load, guarded by the cache mutex
+	value interface{}
+	err   error
+}
+
 // janitor is responsible for cleaning up expired items.
 type janitor struct {
 	Interval time.Duration
-	stop     chan bool
+	stop     chan struct{}
+	once     sync.Once
 }
 
 // Run starts the janitor to periodically clean up expired items.
-func (j *janitor) Run(c *Cache) {
+// It returns when the janitor is stopped or ctx is done.
+func (j *janitor) Run(ctx context.Context, c *cache) {
 	ticker := time.NewTicker(j.Interval)
 	defer ticker.Stop()
 	for {
@@ -318,19 +917,35 @@ func (j *janitor) Run(c *Cache) {
 			c.DeleteExpired()
 		case <-j.stop:
 			return
+		case <-ctx.Done():
+			return
 		}
 	}
 }
 
+// Stop signals the janitor to return. It is safe to call more than once.
+func (j *janitor) Stop() {
+	j.once.Do(func() {
+		close(j.stop)
+	})
+}
+
 // runJanitor initializes and starts the janitor.
-func runJanitor(c *Cache, ci time.Duration) {
+// No janitor is started if ci is not positive.
+func runJanitor(c *cache, ci time.Duration) {
+	c.janitor = nil
+	if ci <= 0 {
+		return
+	}
 	j := &janitor{
 		Interval: ci,
-		stop:     make(chan bool),
+		stop:     make(chan struct{}),
 	}
 	c.janitor = j
-	go j.Run(c)
+	go j.Run(c.ctx, c)
 }
 
-
-
+// stopJanitor is the finalizer for Cache.
+func stopJanitor(c *Cache) {
+	c.StopJanitor()
+}
@@ -1,6 +1,13 @@
 package cache
 
 import (
+	"context"
+	"errors"
+	"math"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -128,4 +135,586 @@ func TestCache_Eviction(t *testing.T) {
 	if cache.Exists("key1") {
 		t.Errorf("LRU eviction failed. 'key1' should have been evicted.")
 	}
-}
\ No newline at end of file
+}
+
+func TestCache_LFUEviction(t *testing.T) {
+	cache := setupCache(5*time.Minute, 1*time.Minute, 2)
+	cache.SetEvictionPolicy(EvictLFU)
+	cache.Set("key1", "value1", 0)
+	cache.Set("key2", "value2", 0)
+
+	// key1 is used more often, so key2 is evicted even though it is more recent
+	cache.Get("key1")
+	cache.Get("key1")
+	cache.Get("key2")
+	cache.Set("key3", "value3", 0)
+
+	if !cache.Exists("key1") || cache.Exists("key2") || !cache.Exists("key3") {
+		t.Errorf("LFU eviction failed. Keys left: %v", cache.Keys())
+	}
+	if stats := cache.Stats(); stats.Evictions != 1 {
+		t.Errorf("Expected 1 eviction, got: %d", stats.Evictions)
+	}
+}
+
+func TestCache_LFUEvictionOrder(t *testing.T) {
+	cache := setupCache(5*time.Minute, 1*time.Minute, 3)
+	cache.Set("key1", "value1", 0)
+	cache.Set("key2", "value2", 0)
+	cache.Set("key3", "value3", 0)
+	cache.Get("key1")
+	cache.Get("key1")
+	cache.Get("key2")
+	cache.Get("key3")
+
+	// Switching policy indexes the existing access counts
+	cache.SetEvictionPolicy(EvictLFU)
+
+	// key2 and key3 tie on one access; key2 is the less recently used
+	cache.Set("key4", "value4", 0)
+	if cache.Exists("key2") {
+		t.Errorf("Expected key2 to be evicted first. Keys left: %v", cache.Keys())
+	}
+
+	// key4 has no accesses, so it goes before key3
+	cache.Set("key5", "value5", 0)
+	if cache.Exists("key4") || !cache.Exists("key1") || !cache.Exists("key3") {
+		t.Errorf("Expected key4 to be evicted next. Keys left: %v", cache.Keys())
+	}
+
+	// Deleting and clearing keep the index consistent
+	cache.Delete("key5")
+	cache.Clear()
+	cache.Set("key6", "value6", 0)
+	if keys := cache.Keys(); len(keys) != 1 || keys[0] != "key6" {
+		t.Errorf("Unexpected keys after Clear: %v", keys)
+	}
+}
+
+func TestCache_MaxBytes(t *testing.T) {
+	cache := setupCache(5*time.Minute, 1*time.Minute, 0)
+	cache.SetMaxBytes(10, func(key string, value interface{}) int64 {
+		return int64(len(value.(string)))
+	})
+	cache.Set("key1", "aaaa", 0)
+	cache.Set("key2", "bbbb", 0)
+	cache.Set("key3", "cccc", 0) // Exceeds 10 bytes, key1 is evicted
+
+	if cache.Exists("key1") {
+		t.Errorf("MaxBytes eviction failed. 'key1' should have been evicted.")
+	}
+	if stats := cache.Stats(); stats.Bytes != 8 || stats.Items != 2 {
+		t.Errorf("Unexpected stats after eviction: %+v", stats)
+	}
+
+	cache.Update("key2", "bbbbbbbbbb", 0) // Grows to 10 bytes, key3 is evicted
+	if cache.Exists("key3") || !cache.Exists("key2") {
+		t.Errorf("MaxBytes eviction on Update failed. Keys left: %v", cache.Keys())
+	}
+}
+
+func TestCache_MaxBytesOversizedItem(t *testing.T) {
+	cache := setupCache(5*time.Minute, 1*time.Minute, 0)
+	cache.SetMaxBytes(10, func(key string, value interface{}) int64 {
+		return int64(len(value.(string)))
+	})
+	cache.Set("key1", "aaaa", 0)
+	cache.Set("key2", "bbbbbbbbbbbbbbbbbbbb", 0) // Larger than the limit on its own
+
+	if cache.Exists("key2") || !cache.Exists("key1") {
+		t.Errorf("Oversized item was not dropped. Keys left: %v", cache.Keys())
+	}
+	if stats := cache.Stats(); stats.Bytes != 4 || stats.Items != 1 || stats.Evictions != 1 {
+		t.Errorf("Unexpected stats after oversized Set: %+v", stats)
+	}
+}
+
+func TestCache_SetMaxBytesDropsOversizedFirst(t *testing.T) {
+	cache := setupCache(5*time.Minute, 1*time.Minute, 0)
+	cache.Set("a", "aa", 0)
+	cache.Set("b", "bb", 0)
+	cache.Set("big", "bbbbbbbbbbbb", 0)
+
+	cache.SetMaxBytes(10, func(key string, value interface{}) int64 {
+		return int64(len(value.(string)))
+	})
+	if cache.Exists("big") || !cache.Exists("a") || !cache.Exists("b") {
+		t.Errorf("SetMaxBytes evicted small items before the oversized one. Keys left: %v", cache.Keys())
+	}
+	if stats := cache.Stats(); stats.Bytes != 4 || stats.Evictions != 1 {
+		t.Errorf("Unexpected stats after SetMaxBytes: %+v", stats)
+	}
+}
+
+func TestCache_MaxBytesEmptyKey(t *testing.T) {
+	cache := setupCache(5*time.Minute, 1*time.Minute, 0)
+	sizeFunc := func(key string, value interface{}) int64 {
+		return int64(len(value.(string)))
+	}
+	cache.Set("", "aaaa", 0)
+	cache.Set("key1", "bbbb", 0)
+
+	// Shrinking the limit evicts the least recently used item, even under ""
+	cache.SetMaxBytes(5, sizeFunc)
+	if cache.Exists("") || !cache.Exists("key1") {
+		t.Errorf("Empty key was not evicted. Keys left: %v", cache.Keys())
+	}
+}
+
+func TestCache_ClearCountsEvictions(t *testing.T) {
+	cache := setupCache(5*time.Minute, 1*time.Minute, 10)
+	cache.Set("key1", "value1", 0)
+	cache.Set("key2", "value2", 0)
+
+	cache.Clear()
+
+	if stats := cache.Stats(); stats.Evictions != 2 || stats.Items != 0 {
+		t.Errorf("Unexpected stats after Clear: %+v", stats)
+	}
+}
+
+func TestCache_GetOrSet(t *testing.T) {
+	cache := setupCache(5*time.Minute, 1*time.Minute, 10)
+
+	var calls int32
+	release := make(chan struct{})
+	loader := func() (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return "loaded", nil
+	}
+
+	var wg sync.WaitGroup
+	results := make(chan interface{}, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			val, err := cache.GetOrSet("key1", 0, loader)
+			if err != nil {
+				t.Errorf("GetOrSet failed. Err: %v", err)
+			}
+			results <- val
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(results)
+
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("Expected loader to be called once, got: %d", n)
+	}
+	for val := range results {
+		if val != "loaded" {
+			t.Errorf("Expected loaded, got: %v", val)
+		}
+	}
+
+	// Errors are returned but not cached
+	loadErr := errors.New("load failed")
+	_, err := cache.GetOrSet("key2", 0, func() (interface{}, error) { return nil, loadErr })
+	if err != loadErr {
+		t.Errorf("Expected loader error, got: %v", err)
+	}
+	if cache.Exists("key2") {
+		t.Errorf("GetOrSet cached a failed load")
+	}
+}
+
+func TestCache_SetGetDeleteMany(t *testing.T) {
+	cache := setupCache(5*time.Minute, 1*time.Minute, 10)
+	cache.SetMany(map[string]interface{}{"key1": "value1", "key2": "value2"}, 0)
+
+	values := cache.GetMany([]string{"key1", "key2", "nonExistingKey"})
+	if len(values) != 2 || values["key1"] != "value1" || values["key2"] != "value2" {
+		t.Errorf("GetMany returned unexpected values: %v", values)
+	}
+	if stats := cache.Stats(); stats.Hits != 2 || stats.Misses != 1 {
+		t.Errorf("GetMany did not record hits and misses: %+v", stats)
+	}
+
+	cache.DeleteMany([]string{"key1", "key2"})
+	if len(cache.Keys()) != 0 {
+		t.Errorf("DeleteMany did not remove all items")
+	}
+}
+
+func TestCache_Add(t *testing.T) {
+	cache := setupCache(5*time.Minute, 1*time.Minute, 10)
+
+	if err := cache.Add("key1", "value1", 0); err != nil {
+		t.Errorf("Add failed. Err: %v", err)
+	}
+	if err := cache.Add("key1", "value2", 0); err != ErrItemExists {
+		t.Errorf("Expected ErrItemExists, got: %v", err)
+	}
+	if val, _ := cache.Get("key1"); val != "value1" {
+		t.Errorf("Add overwrote an existing item. Got: %v", val)
+	}
+}
+
+func TestCache_IncrementDecrement(t *testing.T) {
+	cache := setupCache(5*time.Minute, 1*time.Minute, 10)
+	cache.Set("counter", 1, 0)
+
+	n, err := cache.Increment("counter", 5)
+	if err != nil || n != 6 {
+		t.Errorf("Increment failed. Err: %v, N: %d", err, n)
+	}
+	n, err = cache.Decrement("counter", 2)
+	if err != nil || n != 4 {
+		t.Errorf("Decrement failed. Err: %v, N: %d", err, n)
+	}
+	if val, _ := cache.Get("counter"); val != 4 {
+		t.Errorf("Increment changed the value type. Got: %#v", val)
+	}
+
+	cache.Set("key1", "value1", 0)
+	if _, err := cache.Increment("key1", 1); err != ErrNotInteger {
+		t.Errorf("Expected ErrNotInteger, got: %v", err)
+	}
+	if _, err := cache.Increment("nonExistingKey", 1); err != ErrItemNotFound {
+		t.Errorf("Expected ErrItemNotFound, got: %v", err)
+	}
+}
+
+func TestCache_Touch(t *testing.T) {
+	cache := setupCache(0, 1*time.Minute, 10)
+	cache.Set("key1", "value1", 50*time.Millisecond)
+
+	if err := cache.Touch("key1", 0); err != nil {
+		t.Errorf("Touch failed. Err: %v", err)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if !cache.Exists("key1") {
+		t.Errorf("Touch with no default duration should remove the expiration")
+	}
+
+	if err := cache.Touch("nonExistingKey", time.Minute); err != ErrItemNotFound {
+		t.Errorf("Expected ErrItemNotFound, got: %v", err)
+	}
+}
+
+func TestCache_SlidingExpiration(t *testing.T) {
+	cache := setupCache(0, 1*time.Minute, 10)
+	cache.Set("key1", "value1", time.Minute)
+	cache.Set("key2", "value2", time.Minute)
+	time.Sleep(500 * time.Millisecond)
+
+	// Without sliding expiration a Get leaves the remaining TTL alone
+	cache.Get("key1")
+	if ttl, _ := cache.TTL("key1"); ttl > time.Minute-250*time.Millisecond {
+		t.Errorf("Get renewed the TTL without sliding expiration. TTL: %v", ttl)
+	}
+
+	// With sliding expiration a Get renews it to the full duration
+	cache.SetSlidingExpiration(true)
+	cache.Get("key2")
+	if ttl, _ := cache.TTL("key2"); ttl <= time.Minute-250*time.Millisecond {
+		t.Errorf("Get did not renew the TTL with sliding expiration. TTL: %v", ttl)
+	}
+}
+
+func TestCache_ExpiredCallback(t *testing.T) {
+	cache := setupCache(0, 10*time.Millisecond, 10)
+	defer cache.StopJanitor()
+
+	expired := make(chan string, 1)
+	cache.SetExpiredCallback(func(key string, value interface{}) {
+		expired <- key
+	})
+	cache.Set("key1", "value1", 1*time.Millisecond)
+
+	select {
+	case key := <-expired:
+		if key != "key1" {
+			t.Errorf("Expected key1 to expire, got: %s", key)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Janitor did not call the expired callback")
+	}
+}
+
+func TestCache_StopJanitorTwice(t *testing.T) {
+	cache := setupCache(5*time.Minute, 1*time.Minute, 10)
+
+	done := make(chan struct{})
+	go func() {
+		cache.StopJanitor()
+		cache.StopJanitor()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("StopJanitor blocked when called twice")
+	}
+}
+
+func TestCache_JanitorStopsWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cache := NewCacheWithContext(ctx, 20*time.Millisecond, 0, 10)
+	cancel()
+	time.Sleep(200 * time.Millisecond)
+
+	// A running janitor would remove this within a few of its 20ms ticks
+	cache.Set("key1", "value1", 1*time.Millisecond)
+	time.Sleep(500 * time.Millisecond)
+
+	cache.mutex.RLock()
+	defer cache.mutex.RUnlock()
+	if len(cache.items) != 1 {
+		t.Errorf("Janitor kept running after the context was cancelled")
+	}
+}
+
+func TestCache_SetCleanupInterval(t *testing.T) {
+	cache := setupCache(0, 0, 10) // No janitor
+	cache.Set("key1", "value1", 1*time.Millisecond)
+
+	cache.SetCleanupInterval(10 * time.Millisecond)
+	defer cache.StopJanitor()
+
+	for i := 0; i < 500; i++ {
+		cache.mutex.RLock()
+		n := len(cache.items)
+		cache.mutex.RUnlock()
+		if n == 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("Restarted janitor did not remove the expired item")
+}
+
+func TestCache_FinalizerStopsJanitor(t *testing.T) {
+	inner := setupCache(5*time.Minute, 1*time.Minute, 10).cache
+
+	for i := 0; i < 100; i++ {
+		runtime.GC()
+		inner.mutex.RLock()
+		stopped := inner.janitor == nil
+		inner.mutex.RUnlock()
+		if stopped {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("Janitor was not stopped after the Cache was garbage collected")
+}
+
+func TestCache_TTL(t *testing.T) {
+	cache := setupCache(0, 1*time.Minute, 10)
+	cache.Set("key1", "value1", time.Minute)
+	cache.Set("key2", "value2", 0)
+
+	if ttl, err := cache.TTL("key1"); err != nil || ttl <= 0 || ttl > time.Minute {
+		t.Errorf("TTL failed. Err: %v, TTL: %v", err, ttl)
+	}
+	if ttl, err := cache.TTL("key2"); err != nil || ttl != 0 {
+		t.Errorf("Expected no expiration. Err: %v, TTL: %v", err, ttl)
+	}
+	if _, err := cache.TTL("nonExistingKey"); err != ErrItemNotFound {
+		t.Errorf("Expected ErrItemNotFound, got: %v", err)
+	}
+}
+
+func TestCache_GetOrSetLoaderPanic(t *testing.T) {
+	cache := setupCache(5*time.Minute, 1*time.Minute, 10)
+
+	release := make(chan struct{})
+	panicked := make(chan interface{})
+	go func() {
+		defer func() { panicked <- recover() }()
+		cache.GetOrSet("key1", 0, func() (interface{}, error) {
+			<-release
+			panic("boom")
+		})
+	}()
+
+	// Wait until the panicking loader is registered so the next call waits on it
+	for {
+		cache.mutex.RLock()
+		_, loading := cache.loads["key1"]
+		cache.mutex.RUnlock()
+		if loading {
+			break
+		}
+		runtime.Gosched()
+	}
+
+	result := make(chan error)
+	go func() {
+		_, err := cache.GetOrSet("key1", 0, func() (interface{}, error) {
+			t.Errorf("Second caller ran its own loader instead of waiting")
+			return nil, nil
+		})
+		result <- err
+	}()
+
+	// Give the second caller time to start waiting on the in-flight load
+	for i := 0; i < 1000; i++ {
+		runtime.Gosched()
+	}
+	close(release)
+
+	if r := <-panicked; r != "boom" {
+		t.Errorf("Expected the loader panic to reach its caller, got: %v", r)
+	}
+	if err := <-result; err != ErrLoaderPanic {
+		t.Errorf("Expected ErrLoaderPanic for the waiting caller, got: %v", err)
+	}
+	if cache.Exists("key1") {
+		t.Errorf("GetOrSet cached a value from a panicking loader")
+	}
+}
+
+func TestCache_IncrementOverflow(t *testing.T) {
+	cache := setupCache(5*time.Minute, 1*time.Minute, 10)
+
+	tests := []struct {
+		value interface{}
+		delta int64
+		want  int64
+		err   error
+	}{
+		{int8(100), 27, 127, nil},
+		{int8(100), 28, 0, ErrOverflow},
+		{int8(100), 256, 0, ErrOverflow},
+		{int8(-100), -28, -128, nil},
+		{int8(-100), -29, 0, ErrOverflow},
+		{int64(math.MaxInt64), 1, 0, ErrOverflow},
+		{int64(math.MinInt64), -1, 0, ErrOverflow},
+		{uint8(250), 5, 255, nil},
+		{uint8(250), 6, 0, ErrOverflow},
+		{uint(0), -1, 0, ErrOverflow},
+		{uint(1), -1, 0, nil},
+		{uint64(math.MaxInt64), 1, 0, ErrOverflow},
+		{uint64(math.MaxUint64), 0, 0, ErrOverflow},
+		{uint64(1), math.MinInt64, 0, ErrOverflow},
+	}
+	for _, tt := range tests {
+		cache.Set("counter", tt.value, 0)
+		n, err := cache.Increment("counter", tt.delta)
+		if err != tt.err || n != tt.want {
+			t.Errorf("Increment(%T(%v), %d) = %d, %v; want %d, %v", tt.value, tt.value, tt.delta, n, err, tt.want, tt.err)
+		}
+		if val, _ := cache.Get("counter"); tt.err != nil && val != tt.value {
+			t.Errorf("Increment changed the value on overflow. Got: %#v", val)
+		}
+	}
+
+	// Decrementing by MinInt64 is checked against the item's own range
+	decrements := []struct {
+		value interface{}
+		want  int64
+		err   error
+	}{
+		{int64(-1), math.MaxInt64, nil},
+		{int64(0), 0, ErrOverflow},
+		{int8(-1), 0, ErrOverflow},
+		{uint64(0), 0, ErrOverflow},
+	}
+	for _, tt := range decrements {
+		cache.Set("counter", tt.value, 0)
+		n, err := cache.Decrement("counter", math.MinInt64)
+		if err != tt.err || n != tt.want {
+			t.Errorf("Decrement(%T(%v), MinInt64) = %d, %v; want %d, %v", tt.value, tt.value, n, err, tt.want, tt.err)
+		}
+	}
+	if _, err := cache.Decrement("nonExistingKey", math.MinInt64); err != ErrItemNotFound {
+		t.Errorf("Expected ErrItemNotFound, got: %v", err)
+	}
+}
+
+func TestCache_ExpiredCallbackCanUseCache(t *testing.T) {
+	cache := setupCache(0, 1*time.Minute, 10)
+	cache.SetExpiredCallback(func(key string, value interface{}) {
+		cache.Set("expired:"+key, value, 0)
+	})
+	cache.Set("key1", "value1", 1*time.Nanosecond)
+	time.Sleep(1 * time.Millisecond)
+
+	done := make(chan struct{})
+	go func() {
+		cache.Get("key1") // Expires key1 lazily
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expired callback deadlocked when calling back into the cache")
+	}
+	if val, err := cache.Get("expired:key1"); err != nil || val != "value1" {
+		t.Errorf("Expired callback did not run. Err: %v, Val: %v", err, val)
+	}
+}
+
+// benchmarkFullCacheSet measures Set on a full cache, where every Set evicts.
+func benchmarkFullCacheSet(b *testing.B, policy EvictionPolicy) {
+	const size = 100000
+	cache := setupCache(0, 0, size)
+	cache.SetEvictionPolicy(policy)
+	for i := 0; i < size; i++ {
+		key := strconv.Itoa(i)
+		cache.Set(key, i, 0)
+		if i%2 == 0 {
+			cache.Get(key)
+		}
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cache.Set(strconv.Itoa(size+i), i, 0)
+	}
+}
+
+func BenchmarkCache_SetFullLRU(b *testing.B) {
+	benchmarkFullCacheSet(b, EvictLRU)
+}
+
+func BenchmarkCache_SetFullLFU(b *testing.B) {
+	benchmarkFullCacheSet(b, EvictLFU)
+}
+
+func TestCache_GetOrSetSkipsStaleFill(t *testing.T) {
+	cache := setupCache(0, 1*time.Minute, 10)
+
+	// loadWhile runs GetOrSet with a loader that returns "old" after change runs
+	loadWhile := func(key string, change func()) interface{} {
+		val, err := cache.GetOrSet(key, 0, func() (interface{}, error) {
+			change()
+			return "old", nil
+		})
+		if err != nil {
+			t.Fatalf("GetOrSet failed. Err: %v", err)
+		}
+		return val
+	}
+
+	if val := loadWhile("key1", func() { cache.Set("key1", "new", 0) }); val != "old" {
+		t.Errorf("Expected the loaded value to be returned, got: %v", val)
+	}
+	if val, _ := cache.Get("key1"); val != "new" {
+		t.Errorf("Loader overwrote a newer Set. Got: %v", val)
+	}
+
+	loadWhile("key2", func() { cache.Delete("key2") })
+	if cache.Exists("key2") {
+		t.Errorf("Loader stored a value for a key deleted during the load")
+	}
+
+	loadWhile("key3", func() { cache.Clear() })
+	if cache.Exists("key3") {
+		t.Errorf("Loader stored a value for a key cleared during the load")
+	}
+
+	// Without a change the loaded value is cached as usual
+	loadWhile("key4", func() {})
+	if val, _ := cache.Get("key4"); val != "old" {
+		t.Errorf("GetOrSet did not cache the loaded value. Got: %v", val)
+	}
+}
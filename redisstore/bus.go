@@ -0,0 +1,125 @@
+package redisstore
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+	cache "github.com/ron1tk/CloudbeesGo"
+)
+
+// Bus is a cache.InvalidationBus using Redis pub/sub.
+type Bus struct {
+	client  redis.UniversalClient
+	channel string
+	id      string // Identifies this instance so it can skip its own messages
+}
+
+var _ cache.InvalidationBus = (*Bus)(nil)
+
+// NewBus creates an InvalidationBus that publishes on the given channel.
+// Each instance should create its own Bus.
+func NewBus(client redis.UniversalClient, channel string) (*Bus, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	return &Bus{
+		client:  client,
+		channel: channel,
+		id:      hex.EncodeToString(id),
+	}, nil
+}
+
+// Publish announces that key changed on this instance.
+func (b *Bus) Publish(ctx context.Context, key string) error {
+	return b.client.Publish(ctx, b.channel, formatBusMessage(busMessage{origin: b.id, key: key})).Err()
+}
+
+// PublishClear announces that this instance cleared its cache.
+func (b *Bus) PublishClear(ctx context.Context) error {
+	return b.client.Publish(ctx, b.channel, formatBusMessage(busMessage{origin: b.id, clear: true})).Err()
+}
+
+// Subscribe calls onKey for every key and onClear for every clear published
+// by other instances until ctx is done. The client reconnects and
+// resubscribes on its own after a connection loss; onClear is called then,
+// since messages published while disconnected are lost.
+func (b *Bus) Subscribe(ctx context.Context, onKey func(key string), onClear func()) error {
+	pubsub := b.client.Subscribe(ctx, b.channel)
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return err
+	}
+
+	go func() {
+		defer pubsub.Close()
+		messages := pubsub.ChannelWithSubscriptions()
+		for {
+			select {
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				b.receive(msg, onKey, onClear)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// receive handles a single reply from the subscription. The first
+// subscription was consumed by Subscribe, so any later one is a resubscribe.
+func (b *Bus) receive(msg interface{}, onKey func(key string), onClear func()) {
+	switch msg := msg.(type) {
+	case *redis.Subscription:
+		if msg.Kind == "subscribe" {
+			onClear()
+		}
+	case *redis.Message:
+		m, ok := parseBusMessage(msg.Payload)
+		if !ok || m.origin == b.id {
+			return
+		}
+		if m.clear {
+			onClear()
+		} else {
+			onKey(m.key)
+		}
+	}
+}
+
+// busMessage is an invalidation sent over a Bus channel.
+type busMessage struct {
+	origin string // ID of the publishing Bus
+	key    string
+	clear  bool // The whole cache was cleared; key is unused
+}
+
+// formatBusMessage encodes m as "<origin>:k:<key>" or "<origin>:c".
+func formatBusMessage(m busMessage) string {
+	if m.clear {
+		return m.origin + ":c"
+	}
+	return m.origin + ":k:" + m.key
+}
+
+// parseBusMessage decodes a payload written by formatBusMessage.
+// It reports false for malformed payloads.
+func parseBusMessage(payload string) (busMessage, bool) {
+	origin, rest, found := strings.Cut(payload, ":")
+	if !found || origin == "" {
+		return busMessage{}, false
+	}
+	if rest == "c" {
+		return busMessage{origin: origin, clear: true}, true
+	}
+	if key, found := strings.CutPrefix(rest, "k:"); found {
+		return busMessage{origin: origin, key: key}, true
+	}
+	return busMessage{}, false
+}
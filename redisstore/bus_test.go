@@ -0,0 +1,120 @@
+package redisstore
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestBus_Messages(t *testing.T) {
+	messages := []busMessage{
+		{origin: "0123abcd", key: "key1"},
+		{origin: "0123abcd", key: ""},
+		{origin: "0123abcd", key: "user:1:k:c"},
+		{origin: "0123abcd", clear: true},
+	}
+	for _, m := range messages {
+		got, ok := parseBusMessage(formatBusMessage(m))
+		if !ok || got != m {
+			t.Errorf("Round trip of %+v gave %+v, ok: %v", m, got, ok)
+		}
+	}
+
+	for _, payload := range []string{"", "noseparator", ":k:key1", "0123abcd:x", "0123abcd:kkey1", "0123abcd:"} {
+		if m, ok := parseBusMessage(payload); ok {
+			t.Errorf("Expected %q to be rejected, got: %+v", payload, m)
+		}
+	}
+}
+
+func TestBus_SkipsOwnMessages(t *testing.T) {
+	bus1, err := NewBus(nil, "cache-test")
+	if err != nil {
+		t.Fatalf("NewBus failed. Err: %v", err)
+	}
+	bus2, err := NewBus(nil, "cache-test")
+	if err != nil {
+		t.Fatalf("NewBus failed. Err: %v", err)
+	}
+	if bus1.id == "" || bus1.id == bus2.id {
+		t.Errorf("Expected distinct instance IDs, got %q and %q", bus1.id, bus2.id)
+	}
+}
+
+func TestBus_Receive(t *testing.T) {
+	bus, err := NewBus(nil, "cache-test")
+	if err != nil {
+		t.Fatalf("NewBus failed. Err: %v", err)
+	}
+	var received []string
+	onKey := func(key string) { received = append(received, "key:"+key) }
+	onClear := func() { received = append(received, "clear") }
+
+	replies := []interface{}{
+		&redis.Message{Payload: formatBusMessage(busMessage{origin: "other", key: "key1"})},
+		&redis.Message{Payload: formatBusMessage(busMessage{origin: bus.id, key: "key2"})},
+		&redis.Message{Payload: "malformed"},
+		&redis.Subscription{Kind: "subscribe", Channel: "cache-test", Count: 1},
+		&redis.Message{Payload: formatBusMessage(busMessage{origin: "other", clear: true})},
+		&redis.Pong{},
+	}
+	for _, reply := range replies {
+		bus.receive(reply, onKey, onClear)
+	}
+
+	// A resubscribe clears the cache, as messages may have been missed
+	want := []string{"key:key1", "clear", "clear"}
+	if !reflect.DeepEqual(received, want) {
+		t.Errorf("Expected %v, got %v", want, received)
+	}
+}
+
+func TestBus(t *testing.T) {
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		t.Skip("REDIS_ADDR not set")
+	}
+
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	defer client.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	bus1, err := NewBus(client, "cache-test")
+	if err != nil {
+		t.Fatalf("NewBus failed. Err: %v", err)
+	}
+	bus2, err := NewBus(client, "cache-test")
+	if err != nil {
+		t.Fatalf("NewBus failed. Err: %v", err)
+	}
+	received := make(chan string, 2)
+	onClear := func() { received <- "clear" }
+	if err := bus1.Subscribe(ctx, func(key string) { received <- "bus1:" + key }, onClear); err != nil {
+		t.Fatalf("Subscribe failed. Err: %v", err)
+	}
+	if err := bus2.Subscribe(ctx, func(key string) { received <- "bus2:" + key }, onClear); err != nil {
+		t.Fatalf("Subscribe failed. Err: %v", err)
+	}
+
+	if err := bus1.Publish(ctx, "key1"); err != nil {
+		t.Fatalf("Publish failed. Err: %v", err)
+	}
+	select {
+	case msg := <-received:
+		if msg != "bus2:key1" {
+			t.Errorf("Expected bus2 to receive key1, got: %s", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Invalidation was not delivered")
+	}
+	select {
+	case msg := <-received:
+		t.Errorf("Publisher received its own message: %s", msg)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,111 @@
+// Package redisstore provides a Store and an InvalidationBus backed by Redis,
+// for sharing cached data between several instances of an application.
+package redisstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	cache "github.com/ron1tk/CloudbeesGo"
+)
+
+// Store is a cache.Store backed by Redis.
+//
+// Values are encoded with encoding/gob, so custom types must be registered
+// with gob.Register before they are stored.
+type Store struct {
+	client          redis.UniversalClient
+	prefix          string
+	defaultDuration time.Duration
+}
+
+var _ cache.Store = (*Store)(nil)
+
+// NewStore creates a Store that keeps items in Redis under keys
+// starting with prefix. If defaultDuration is 0, items will not expire
+// unless a specific duration is set.
+func NewStore(client redis.UniversalClient, prefix string, defaultDuration time.Duration) *Store {
+	return &Store{
+		client:          client,
+		prefix:          prefix,
+		defaultDuration: defaultDuration,
+	}
+}
+
+// Set adds an item to Redis with a specified duration.
+// If duration is 0, the default duration is used.
+// If both are 0, the item does not expire.
+func (s *Store) Set(ctx context.Context, key string, value interface{}, duration time.Duration) error {
+	data, err := encodeValue(value)
+	if err != nil {
+		return err
+	}
+
+	if duration <= 0 {
+		duration = s.defaultDuration
+	}
+	if duration < 0 {
+		duration = 0
+	}
+	return s.client.Set(ctx, s.prefix+key, data, duration).Err()
+}
+
+// Get retrieves an item from Redis.
+func (s *Store) Get(ctx context.Context, key string) (interface{}, error) {
+	data, err := s.client.Get(ctx, s.prefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, cache.ErrItemNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeValue(data)
+}
+
+// Delete removes an item from Redis.
+func (s *Store) Delete(ctx context.Context, key string) error {
+	return s.client.Del(ctx, s.prefix+key).Err()
+}
+
+// TTL returns the time left before an item expires.
+func (s *Store) TTL(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := s.client.PTTL(ctx, s.prefix+key).Result()
+	if err != nil {
+		return 0, err
+	}
+	return ttlFromPTTL(ttl)
+}
+
+// ttlFromPTTL maps a PTTL reply onto Store.TTL semantics. Redis reports -2
+// for a missing key and -1 for a key without expiration.
+func ttlFromPTTL(ttl time.Duration) (time.Duration, error) {
+	switch ttl {
+	case -2:
+		return 0, cache.ErrItemNotFound
+	case -1:
+		return 0, nil
+	}
+	return ttl, nil
+}
+
+// encodeValue gob-encodes a value so its concrete type survives decoding.
+func encodeValue(value interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&value); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeValue reverses encodeValue.
+func decodeValue(data []byte) (interface{}, error) {
+	var value interface{}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
@@ -0,0 +1,103 @@
+package redisstore
+
+import (
+	"context"
+	"encoding/gob"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	cache "github.com/ron1tk/CloudbeesGo"
+)
+
+// testStore runs the same checks as the cache package's MemoryStore test.
+func testStore(t *testing.T, store cache.Store) {
+	ctx := context.Background()
+
+	if err := store.Set(ctx, "key1", "value1", time.Minute); err != nil {
+		t.Fatalf("Set failed. Err: %v", err)
+	}
+	val, err := store.Get(ctx, "key1")
+	if err != nil || val != "value1" {
+		t.Errorf("Set or Get failed. Err: %v, Val: %v", err, val)
+	}
+
+	ttl, err := store.TTL(ctx, "key1")
+	if err != nil || ttl <= 0 || ttl > time.Minute {
+		t.Errorf("TTL failed. Err: %v, TTL: %v", err, ttl)
+	}
+
+	if err := store.Set(ctx, "key2", 42, 0); err != nil {
+		t.Fatalf("Set failed. Err: %v", err)
+	}
+	if ttl, err := store.TTL(ctx, "key2"); err != nil || ttl != 0 {
+		t.Errorf("Expected no expiration. Err: %v, TTL: %v", err, ttl)
+	}
+	if val, _ := store.Get(ctx, "key2"); val != 42 {
+		t.Errorf("Get did not preserve the value type. Got: %#v", val)
+	}
+
+	if err := store.Delete(ctx, "key1"); err != nil {
+		t.Errorf("Delete failed. Err: %v", err)
+	}
+	if _, err := store.Get(ctx, "key1"); err != cache.ErrItemNotFound {
+		t.Errorf("Expected ErrItemNotFound, got: %v", err)
+	}
+	if _, err := store.TTL(ctx, "key1"); err != cache.ErrItemNotFound {
+		t.Errorf("Expected ErrItemNotFound, got: %v", err)
+	}
+}
+
+// storedStruct is a custom type that must be registered with gob.
+type storedStruct struct {
+	Name  string
+	Count int
+}
+
+func TestStore_EncodeDecode(t *testing.T) {
+	gob.Register(storedStruct{})
+
+	values := []interface{}{"value1", 42, int64(-7), uint8(3), 1.5, true, []string{"a", "b"}, storedStruct{"x", 2}}
+	for _, value := range values {
+		data, err := encodeValue(value)
+		if err != nil {
+			t.Fatalf("encodeValue(%#v) failed. Err: %v", value, err)
+		}
+		got, err := decodeValue(data)
+		if err != nil || !reflect.DeepEqual(got, value) {
+			t.Errorf("Round trip of %#v gave %#v, err: %v", value, got, err)
+		}
+	}
+
+	if _, err := encodeValue(struct{ Unregistered int }{1}); err == nil {
+		t.Errorf("Expected an error for an unregistered type")
+	}
+	if _, err := decodeValue([]byte("not gob")); err == nil {
+		t.Errorf("Expected an error for invalid data")
+	}
+}
+
+func TestStore_TTLFromPTTL(t *testing.T) {
+	if _, err := ttlFromPTTL(-2); err != cache.ErrItemNotFound {
+		t.Errorf("Expected cache.ErrItemNotFound for -2, got: %v", err)
+	}
+	if ttl, err := ttlFromPTTL(-1); err != nil || ttl != 0 {
+		t.Errorf("Expected no expiration for -1. Err: %v, TTL: %v", err, ttl)
+	}
+	if ttl, err := ttlFromPTTL(1500 * time.Millisecond); err != nil || ttl != 1500*time.Millisecond {
+		t.Errorf("Expected 1.5s. Err: %v, TTL: %v", err, ttl)
+	}
+}
+
+func TestStore(t *testing.T) {
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		t.Skip("REDIS_ADDR not set")
+	}
+
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	defer client.Close()
+	testStore(t, NewStore(client, "cache-test:", 0))
+}
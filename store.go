@@ -0,0 +1,62 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// Store is a key/value store with per-item expiration. It lets the same
+// calling code run against the in-memory cache on a single instance or a
+// shared backend such as Redis when running several instances.
+//
+// Implementations return ErrItemNotFound from Get and TTL when the key does
+// not exist, and a TTL of 0 for items that never expire.
+type Store interface {
+	Set(ctx context.Context, key string, value interface{}, duration time.Duration) error
+	Get(ctx context.Context, key string) (interface{}, error)
+	Delete(ctx context.Context, key string) error
+	TTL(ctx context.Context, key string) (time.Duration, error)
+}
+
+// MemoryStore adapts a Cache to the Store interface.
+type MemoryStore struct {
+	cache *Cache
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+// NewMemoryStore returns a Store backed by c.
+func NewMemoryStore(c *Cache) *MemoryStore {
+	return &MemoryStore{cache: c}
+}
+
+// Set adds an item to the cache. See Cache.Set for how duration is applied.
+func (s *MemoryStore) Set(ctx context.Context, key string, value interface{}, duration time.Duration) error {
+	s.cache.Set(key, value, duration)
+	return nil
+}
+
+// Get retrieves an item from the cache.
+// An expired item is reported as ErrItemNotFound, matching other stores.
+func (s *MemoryStore) Get(ctx context.Context, key string) (interface{}, error) {
+	value, err := s.cache.Get(key)
+	if err == ErrItemExpired {
+		return nil, ErrItemNotFound
+	}
+	return value, err
+}
+
+// Delete removes an item from the cache.
+func (s *MemoryStore) Delete(ctx context.Context, key string) error {
+	s.cache.Delete(key)
+	return nil
+}
+
+// TTL returns the time left before an item expires.
+func (s *MemoryStore) TTL(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := s.cache.TTL(key)
+	if err == ErrItemExpired {
+		return 0, ErrItemNotFound
+	}
+	return ttl, err
+}
@@ -0,0 +1,49 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// testStore exercises the behaviour every Store implementation must share.
+func testStore(t *testing.T, store Store) {
+	ctx := context.Background()
+
+	if err := store.Set(ctx, "key1", "value1", time.Minute); err != nil {
+		t.Fatalf("Set failed. Err: %v", err)
+	}
+	val, err := store.Get(ctx, "key1")
+	if err != nil || val != "value1" {
+		t.Errorf("Set or Get failed. Err: %v, Val: %v", err, val)
+	}
+
+	ttl, err := store.TTL(ctx, "key1")
+	if err != nil || ttl <= 0 || ttl > time.Minute {
+		t.Errorf("TTL failed. Err: %v, TTL: %v", err, ttl)
+	}
+
+	if err := store.Set(ctx, "key2", 42, 0); err != nil {
+		t.Fatalf("Set failed. Err: %v", err)
+	}
+	if ttl, err := store.TTL(ctx, "key2"); err != nil || ttl != 0 {
+		t.Errorf("Expected no expiration. Err: %v, TTL: %v", err, ttl)
+	}
+	if val, _ := store.Get(ctx, "key2"); val != 42 {
+		t.Errorf("Get did not preserve the value type. Got: %#v", val)
+	}
+
+	if err := store.Delete(ctx, "key1"); err != nil {
+		t.Errorf("Delete failed. Err: %v", err)
+	}
+	if _, err := store.Get(ctx, "key1"); err != ErrItemNotFound {
+		t.Errorf("Expected ErrItemNotFound, got: %v", err)
+	}
+	if _, err := store.TTL(ctx, "key1"); err != ErrItemNotFound {
+		t.Errorf("Expected ErrItemNotFound, got: %v", err)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore(setupCache(0, 1*time.Minute, 10)))
+}